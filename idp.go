@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type oidcDiscoveryDocument struct {
+	TokenEndpoint string `json:"token_endpoint"`
+}
+
+func discoverOIDCTokenEndpoint(domain string) (string, error) {
+	res, err := http.Get(fmt.Sprintf("https://%s/.well-known/openid-configuration", domain))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var doc oidcDiscoveryDocument
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", err
+	}
+	if doc.TokenEndpoint == "" {
+		return "", errors.New("openid-configuration response did not include a token_endpoint")
+	}
+
+	return doc.TokenEndpoint, nil
+}
+
+// KeycloakProvider talks to a Keycloak realm. Domain is expected to already
+// include the realm path, e.g. "keycloak.example.com/realms/my-realm".
+type KeycloakProvider struct{}
+
+func (KeycloakProvider) tokenEndpoint(domain string) string {
+	return fmt.Sprintf("https://%s/protocol/openid-connect/token", domain)
+}
+
+func (p KeycloakProvider) GetManagementToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error) {
+	payload := url.Values{}
+	payload.Set("grant_type", "client_credentials")
+	payload.Set("client_id", params.ClientID)
+	payload.Set("client_secret", params.ClientSecret)
+
+	return executeOauthTokenRequest(ExecuteHttpPostRequestParams{
+		Payload: strings.NewReader(payload.Encode()),
+		URL:     p.tokenEndpoint(params.Domain),
+		Headers: RequestHeaders{
+			ContentType: "application/x-www-form-urlencoded",
+		},
+		Debug: params.Debug,
+	})
+}
+
+// EnsureResourceServer registers a confidential client representing the API,
+// Keycloak's equivalent of an Auth0 resource server.
+func (KeycloakProvider) EnsureResourceServer(params MGMTAPIRequestParams) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"clientId": fmt.Sprintf("https://%s/me/", params.Domain),
+		"name":     "jwt_tool Resource Server",
+		"protocol": "openid-connect",
+		"enabled":  true,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = executeHttpPostRequest(ExecuteHttpPostRequestParams{
+		Payload: strings.NewReader(string(payload)),
+		URL:     fmt.Sprintf("https://%s/clients", params.Domain),
+		Headers: RequestHeaders{
+			ContentType:   "application/json",
+			Authorization: fmt.Sprintf("Bearer %s", params.OauthTokenResponse.AccessToken),
+		},
+		Debug: params.Debug,
+	})
+
+	return err
+}
+
+// EnsureClientGrant is a no-op for Keycloak: scope assignment happens via
+// client scopes configured on the realm, not a per-call grant endpoint.
+func (KeycloakProvider) EnsureClientGrant(params MGMTAPIRequestParams) error {
+	return nil
+}
+
+func (p KeycloakProvider) GetUserToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error) {
+	payload := url.Values{}
+	payload.Set("grant_type", "password")
+	payload.Set("username", params.Username)
+	payload.Set("password", params.Password)
+	payload.Set("client_id", params.ClientID)
+	payload.Set("client_secret", params.ClientSecret)
+
+	return executeOauthTokenRequest(ExecuteHttpPostRequestParams{
+		Payload: strings.NewReader(payload.Encode()),
+		URL:     p.tokenEndpoint(params.Domain),
+		Headers: RequestHeaders{
+			ContentType: "application/x-www-form-urlencoded",
+		},
+		Debug: params.Debug,
+	})
+}
+
+// OktaProvider talks to an Okta org's OAuth2 and admin APIs.
+type OktaProvider struct{}
+
+func (OktaProvider) tokenEndpoint(domain string) string {
+	return fmt.Sprintf("https://%s/oauth2/v1/token", domain)
+}
+
+func (p OktaProvider) GetManagementToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error) {
+	payload := url.Values{}
+	payload.Set("grant_type", "client_credentials")
+	payload.Set("client_id", params.ClientID)
+	payload.Set("client_secret", params.ClientSecret)
+	payload.Set("scope", "okta.authorizationServers.manage")
+
+	return executeOauthTokenRequest(ExecuteHttpPostRequestParams{
+		Payload: strings.NewReader(payload.Encode()),
+		URL:     p.tokenEndpoint(params.Domain),
+		Headers: RequestHeaders{
+			ContentType: "application/x-www-form-urlencoded",
+		},
+		Debug: params.Debug,
+	})
+}
+
+// EnsureResourceServer creates an Okta custom authorization server, Okta's
+// equivalent of an Auth0 resource server.
+func (OktaProvider) EnsureResourceServer(params MGMTAPIRequestParams) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"name":        "jwt_tool Resource Server",
+		"audiences":   []string{fmt.Sprintf("https://%s/me/", params.Domain)},
+		"description": "Created by jwt_tool",
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = executeHttpPostRequest(ExecuteHttpPostRequestParams{
+		Payload: strings.NewReader(string(payload)),
+		URL:     fmt.Sprintf("https://%s/api/v1/authorizationServers", params.Domain),
+		Headers: RequestHeaders{
+			ContentType:   "application/json",
+			Authorization: fmt.Sprintf("Bearer %s", params.OauthTokenResponse.AccessToken),
+		},
+		Debug: params.Debug,
+	})
+
+	return err
+}
+
+// EnsureClientGrant is a no-op for Okta: scope grants are configured on the
+// authorization server's access policies, not a per-call grant endpoint.
+func (OktaProvider) EnsureClientGrant(params MGMTAPIRequestParams) error {
+	return nil
+}
+
+func (p OktaProvider) GetUserToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error) {
+	payload := url.Values{}
+	payload.Set("grant_type", "password")
+	payload.Set("username", params.Username)
+	payload.Set("password", params.Password)
+	payload.Set("client_id", params.ClientID)
+	payload.Set("client_secret", params.ClientSecret)
+
+	return executeOauthTokenRequest(ExecuteHttpPostRequestParams{
+		Payload: strings.NewReader(payload.Encode()),
+		URL:     p.tokenEndpoint(params.Domain),
+		Headers: RequestHeaders{
+			ContentType: "application/x-www-form-urlencoded",
+		},
+		Debug: params.Debug,
+	})
+}
+
+// GenericOIDCProvider drives any OIDC-compliant IdP purely from its
+// .well-known/openid-configuration document. There is no standard
+// management API across providers, so resource-server and client-grant
+// setup is left out of band.
+type GenericOIDCProvider struct{}
+
+func (GenericOIDCProvider) GetManagementToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error) {
+	tokenEndpoint, err := discoverOIDCTokenEndpoint(params.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := url.Values{}
+	payload.Set("grant_type", "client_credentials")
+	payload.Set("client_id", params.ClientID)
+	payload.Set("client_secret", params.ClientSecret)
+
+	return executeOauthTokenRequest(ExecuteHttpPostRequestParams{
+		Payload: strings.NewReader(payload.Encode()),
+		URL:     tokenEndpoint,
+		Headers: RequestHeaders{
+			ContentType: "application/x-www-form-urlencoded",
+		},
+		Debug: params.Debug,
+	})
+}
+
+func (GenericOIDCProvider) EnsureResourceServer(params MGMTAPIRequestParams) error {
+	return errors.New("EnsureResourceServer is not supported by the generic OIDC provider; provision the resource server out of band")
+}
+
+func (GenericOIDCProvider) EnsureClientGrant(params MGMTAPIRequestParams) error {
+	return errors.New("EnsureClientGrant is not supported by the generic OIDC provider; provision the client grant out of band")
+}
+
+func (GenericOIDCProvider) GetUserToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error) {
+	tokenEndpoint, err := discoverOIDCTokenEndpoint(params.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := url.Values{}
+	payload.Set("grant_type", "password")
+	payload.Set("username", params.Username)
+	payload.Set("password", params.Password)
+	payload.Set("client_id", params.ClientID)
+	payload.Set("client_secret", params.ClientSecret)
+
+	return executeOauthTokenRequest(ExecuteHttpPostRequestParams{
+		Payload: strings.NewReader(payload.Encode()),
+		URL:     tokenEndpoint,
+		Headers: RequestHeaders{
+			ContentType: "application/x-www-form-urlencoded",
+		},
+		Debug: params.Debug,
+	})
+}
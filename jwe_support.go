@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+)
+
+// EncryptionConfig is Config.Custom.Encryption: it turns createToken's
+// signed JWT into a JWE, and tells the verify subcommand how to decrypt one
+// back down to the inner signed token.
+type EncryptionConfig struct {
+	Alg                        string `json:"alg"`
+	Enc                        string `json:"enc"`
+	RecipientPublicKeyFilePath string `json:"recipient_public_key_file_path,omitempty"`
+	RecipientJWKEndpoint       string `json:"recipient_jwk_endpoint,omitempty"`
+	PrivateKeyFilePath         string `json:"private_key_file_path,omitempty"`
+}
+
+func keyEncryptionAlgorithm(alg string) (jwa.KeyEncryptionAlgorithm, error) {
+	switch alg {
+	case "RSA-OAEP":
+		return jwa.RSA_OAEP, nil
+	case "RSA-OAEP-256":
+		return jwa.RSA_OAEP_256, nil
+	case "ECDH-ES+A256KW":
+		return jwa.ECDH_ES_A256KW, nil
+	case "dir":
+		return jwa.DIRECT, nil
+	default:
+		return "", errors.New(fmt.Sprintf("unsupported JWE key management alg: %s", alg))
+	}
+}
+
+func contentEncryptionAlgorithm(enc string) (jwa.ContentEncryptionAlgorithm, error) {
+	switch enc {
+	case "A256GCM":
+		return jwa.A256GCM, nil
+	case "A128CBC-HS256":
+		return jwa.A128CBC_HS256, nil
+	default:
+		return "", errors.New(fmt.Sprintf("unsupported JWE content encryption alg: %s", enc))
+	}
+}
+
+// isJWE reports whether tokenString is a five-segment compact JWE, as
+// opposed to a three-segment compact JWS.
+func isJWE(tokenString string) bool {
+	return strings.Count(tokenString, ".") == 4
+}
+
+// loadRecipientKey returns the key createToken should encrypt to: the raw
+// shared secret for "dir", otherwise the recipient's public key, either
+// from a local PEM file or fetched from a JWKS endpoint.
+func loadRecipientKey(keyalg jwa.KeyEncryptionAlgorithm, filePath string, jwkEndpoint string) (interface{}, error) {
+	if keyalg == jwa.DIRECT {
+		if filePath == "" {
+			return nil, errors.New("encryption.recipient_public_key_file_path (shared secret) is required for dir key management")
+		}
+		return os.ReadFile(filePath)
+	}
+
+	if jwkEndpoint != "" {
+		return getJwkSet(&GetJWKSetParams{WellKnownEndpoint: jwkEndpoint})
+	}
+
+	if filePath == "" {
+		return nil, errors.New("encryption.recipient_public_key_file_path or encryption.recipient_jwk_endpoint is required")
+	}
+
+	pemBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("could not decode PEM block from recipient public key file")
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// loadDecryptionKey returns the private-side counterpart of
+// loadRecipientKey, used by the verify subcommand to open a JWE.
+func loadDecryptionKey(keyalg jwa.KeyEncryptionAlgorithm, privateKeyFilePath string) (interface{}, error) {
+	if privateKeyFilePath == "" {
+		return nil, errors.New("encryption.private_key_file_path is required to decrypt a JWE")
+	}
+
+	pemBytes, err := os.ReadFile(privateKeyFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch keyalg {
+	case jwa.DIRECT:
+		return pemBytes, nil
+	case jwa.RSA_OAEP, jwa.RSA_OAEP_256:
+		return jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+	case jwa.ECDH_ES_A256KW:
+		return jwt.ParseECPrivateKeyFromPEM(pemBytes)
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported JWE key management alg for decryption: %s", keyalg))
+	}
+}
+
+// encryptJWE wraps a compact signed JWT in a JWE per encryptionConfig,
+// producing the nested signed-then-encrypted token.
+func encryptJWE(signedToken string, encryptionConfig EncryptionConfig) (string, error) {
+	keyalg, err := keyEncryptionAlgorithm(encryptionConfig.Alg)
+	if err != nil {
+		return "", err
+	}
+
+	contentalg, err := contentEncryptionAlgorithm(encryptionConfig.Enc)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := loadRecipientKey(keyalg, encryptionConfig.RecipientPublicKeyFilePath, encryptionConfig.RecipientJWKEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := jwe.Encrypt([]byte(signedToken), keyalg, key, contentalg, jwa.NoCompress)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encrypted), nil
+}
+
+// decryptJWE opens a compact JWE and returns the inner (still signed)
+// token, for the verify subcommand to validate as usual.
+func decryptJWE(tokenString string, encryptionConfig EncryptionConfig) (string, error) {
+	keyalg, err := keyEncryptionAlgorithm(encryptionConfig.Alg)
+	if err != nil {
+		return "", err
+	}
+
+	privateKey, err := loadDecryptionKey(keyalg, encryptionConfig.PrivateKeyFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	decrypted, err := jwe.Decrypt([]byte(tokenString), keyalg, privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(decrypted), nil
+}
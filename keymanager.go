@@ -0,0 +1,365 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// defaultRetainedKeys is how many retired keys stay published in the JWKS
+// (verification-only) after a new key is rotated in.
+const defaultRetainedKeys = 2
+
+// KeyManagerMeta is the on-disk sidecar record for a single managed key.
+// The key material itself lives alongside it as "<kid>.pem".
+type KeyManagerMeta struct {
+	KID       string     `json:"kid"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// KeyManager maintains a rolling set of RSA keypairs on disk, rotating in a
+// new signing key on RotationInterval and keeping retired keys around only
+// long enough for in-flight tokens to still verify.
+type KeyManager struct {
+	dir      string
+	interval time.Duration
+	retain   int
+
+	mu   sync.Mutex
+	keys []KeyManagerMeta
+}
+
+func metaFilePath(dir string) string {
+	return filepath.Join(dir, "keys.json")
+}
+
+func keyFilePath(dir string, kid string) string {
+	return filepath.Join(dir, kid+".pem")
+}
+
+// NewKeyManager loads an existing key set from dir, or bootstraps one if
+// dir is empty/missing. When seedPrivateKeyPEM is non-nil and dir has no
+// tracked keys yet, it becomes the first active key instead of a freshly
+// generated one.
+func NewKeyManager(dir string, interval time.Duration, retain int, seedPrivateKeyPEM []byte) (*KeyManager, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	km := &KeyManager{dir: dir, interval: interval, retain: retain}
+
+	metaBytes, err := os.ReadFile(metaFilePath(dir))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		if err := json.Unmarshal(metaBytes, &km.keys); err != nil {
+			return nil, err
+		}
+	}
+
+	if km.activeIndex() == -1 {
+		var seedKey *rsa.PrivateKey
+		if len(seedPrivateKeyPEM) > 0 {
+			seedKey, err = jwt.ParseRSAPrivateKeyFromPEM(seedPrivateKeyPEM)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err := km.rotateWithKey(seedKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return km, nil
+}
+
+// activeIndex returns the index of the key without a RetiredAt, or -1 if
+// there isn't one (e.g. on first run).
+func (km *KeyManager) activeIndex() int {
+	for i := len(km.keys) - 1; i >= 0; i-- {
+		if km.keys[i].RetiredAt == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+func (km *KeyManager) saveMeta() error {
+	metaBytes, err := json.MarshalIndent(km.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaFilePath(km.dir), metaBytes, 0600)
+}
+
+// rotate generates a new keypair, marks it active, retires the previous
+// active key, and prunes any key that has aged out of the retention window.
+// Callers must hold km.mu.
+func (km *KeyManager) rotate() error {
+	return km.rotateWithKey(nil)
+}
+
+// rotateWithKey is like rotate but signs in privateKey as the new active
+// key instead of generating one, when privateKey is non-nil. Callers must
+// hold km.mu.
+func (km *KeyManager) rotateWithKey(privateKey *rsa.PrivateKey) error {
+	var err error
+	if privateKey == nil {
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+	}
+
+	jwkKey, err := jwk.New(&privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	kid, err := rfc7638Thumbprint(jwkKey)
+	if err != nil {
+		return err
+	}
+
+	der := x509.MarshalPKCS1PrivateKey(privateKey)
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(keyFilePath(km.dir, kid), pemBytes, 0600); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if activeIndex := km.activeIndex(); activeIndex != -1 {
+		km.keys[activeIndex].RetiredAt = &now
+	}
+	km.keys = append(km.keys, KeyManagerMeta{KID: kid, CreatedAt: now})
+
+	km.prune()
+
+	return km.saveMeta()
+}
+
+// prune drops retired keys once more than retain of them are being kept
+// around for verification, removing their metadata entry and PEM file.
+func (km *KeyManager) prune() {
+	retiredCount := 0
+	kept := make([]KeyManagerMeta, 0, len(km.keys))
+	for i := len(km.keys) - 1; i >= 0; i-- {
+		meta := km.keys[i]
+		if meta.RetiredAt != nil {
+			retiredCount++
+			if retiredCount > km.retain {
+				os.Remove(keyFilePath(km.dir, meta.KID))
+				continue
+			}
+		}
+		kept = append([]KeyManagerMeta{meta}, kept...)
+	}
+	km.keys = kept
+}
+
+// RotateNow forces a rotation outside of the regular interval, e.g. for the
+// -rotate-now CLI flag.
+func (km *KeyManager) RotateNow() error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	return km.rotate()
+}
+
+// MaybeRotate rotates in a new key if the active key is older than the
+// configured RotationInterval. It is a no-op when interval is zero.
+func (km *KeyManager) MaybeRotate() error {
+	if km.interval <= 0 {
+		return nil
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	activeIndex := km.activeIndex()
+	if activeIndex == -1 {
+		return km.rotate()
+	}
+
+	if time.Since(km.keys[activeIndex].CreatedAt) < km.interval {
+		return nil
+	}
+
+	return km.rotate()
+}
+
+// ActiveKey returns the current signing key and its kid.
+func (km *KeyManager) ActiveKey() (*rsa.PrivateKey, string, error) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	activeIndex := km.activeIndex()
+	if activeIndex == -1 {
+		return nil, "", errors.New("KeyManager has no active key")
+	}
+
+	kid := km.keys[activeIndex].KID
+	privateKey, err := km.loadPrivateKey(kid)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return privateKey, kid, nil
+}
+
+// PublicKeyForKID returns the public key for kid if it is still published
+// (active or within the retention window), for verifying tokens signed
+// before the most recent rotation.
+func (km *KeyManager) PublicKeyForKID(kid string) (*rsa.PublicKey, error) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	for _, meta := range km.keys {
+		if meta.KID == kid {
+			privateKey, err := km.loadPrivateKey(kid)
+			if err != nil {
+				return nil, err
+			}
+			return &privateKey.PublicKey, nil
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("no published key for kid: %s", kid))
+}
+
+func (km *KeyManager) loadPrivateKey(kid string) (*rsa.PrivateKey, error) {
+	pemBytes, err := os.ReadFile(keyFilePath(km.dir, kid))
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+}
+
+// ListKeys returns the metadata for every key currently tracked, oldest
+// first, for the -list-keys CLI flag.
+func (km *KeyManager) ListKeys() []KeyManagerMeta {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	keys := make([]KeyManagerMeta, len(km.keys))
+	copy(keys, km.keys)
+	return keys
+}
+
+// JWKS builds a JWK set containing every currently published key, so tokens
+// signed before the latest rotation still verify against it.
+func (km *KeyManager) JWKS() (jwk.Set, error) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	set := jwk.NewSet()
+	for _, meta := range km.keys {
+		privateKey, err := km.loadPrivateKey(meta.KID)
+		if err != nil {
+			return nil, err
+		}
+
+		jwkKey, err := jwk.New(&privateKey.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := jwkKey.Set(jwk.KeyIDKey, meta.KID); err != nil {
+			return nil, err
+		}
+		if err := jwkKey.Set(jwk.AlgorithmKey, "RS256"); err != nil {
+			return nil, err
+		}
+		if err := jwkKey.Set(jwk.KeyUsageKey, "sig"); err != nil {
+			return nil, err
+		}
+
+		set.Add(jwkKey)
+	}
+
+	return set, nil
+}
+
+// resolveKeysDir picks the key manager's storage directory: the -keys-dir
+// flag if given, then Config.Custom.KeysDir, then a sensible default.
+func resolveKeysDir(config Config, keysDirFlag string) string {
+	if keysDirFlag != "" {
+		return keysDirFlag
+	}
+	if config.Custom.KeysDir != nil {
+		return *config.Custom.KeysDir
+	}
+	return "jwt_tool_keys"
+}
+
+// resolveRotationInterval parses Config.Custom.RotationInterval. A missing
+// value means rotation is manual-only (-rotate-now).
+func resolveRotationInterval(config Config) (time.Duration, error) {
+	if config.Custom.RotationInterval == nil {
+		return 0, nil
+	}
+	return time.ParseDuration(*config.Custom.RotationInterval)
+}
+
+// seedPrivateKeyPEM reads Config.Custom.PrivateKeyFilePath, if set, so a
+// freshly bootstrapped KeyManager can start from an existing key instead of
+// generating one.
+func seedPrivateKeyPEM(config Config) []byte {
+	if config.Custom.PrivateKeyFilePath == nil {
+		return nil
+	}
+
+	pemBytes, err := os.ReadFile(*config.Custom.PrivateKeyFilePath)
+	if err != nil {
+		return nil
+	}
+
+	return pemBytes
+}
+
+// handleKeyManagerCommand implements the -rotate-now and -list-keys CLI
+// flags for manual key-manager control outside of -serve mode.
+func handleKeyManagerCommand(config Config, keysDirFlag string, rotateNow bool, listKeys bool) error {
+	dir := resolveKeysDir(config, keysDirFlag)
+
+	rotationInterval, err := resolveRotationInterval(config)
+	if err != nil {
+		return err
+	}
+
+	km, err := NewKeyManager(dir, rotationInterval, defaultRetainedKeys, seedPrivateKeyPEM(config))
+	if err != nil {
+		return err
+	}
+
+	if rotateNow {
+		if err := km.RotateNow(); err != nil {
+			return err
+		}
+		fmt.Print("Rotated in a new signing key.\n")
+	}
+
+	if listKeys {
+		keysJSON, err := json.MarshalIndent(km.ListKeys(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(keysJSON), "\n")
+	}
+
+	return nil
+}
@@ -20,6 +20,12 @@ type Config struct {
 		JWKLocal           bool               `json:"jwk_local,omitempty"`
 		JWKLocalFile       string             `json:"jwk_local_file,omitempty"`
 		PrivateKeyFilePath *string            `json:"private_key_file_path,omitempty"`
+		Alg                *string            `json:"alg,omitempty"`
+		Secret             *string            `json:"secret,omitempty"`
+		RotationInterval   *string            `json:"rotation_interval,omitempty"`
+		KeysDir            *string            `json:"keys_dir,omitempty"`
+		TokenDialect       *string            `json:"token_dialect,omitempty"`
+		Encryption         *EncryptionConfig  `json:"encryption,omitempty"`
 	}
 	// RS
 	RS struct {
@@ -29,6 +35,11 @@ type Config struct {
 		ClientSecret *string `json:"client_secret,omitempty"`
 		Username     *string `json:"username,omitempty"`
 		Password     *string `json:"password,omitempty"`
+		Provider     *string `json:"provider,omitempty"`
+	}
+	// Serve
+	Serve struct {
+		Issuer *string `json:"issuer,omitempty"`
 	}
 	UseRS bool `json:"use_rs,omitempty"`
 	Debug bool `json:"debug,omitempty"`
@@ -67,12 +78,45 @@ func parseConfig(configFile string) (*Config, error) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerifyCommand(os.Args[2:]))
+	}
+
 	configFile := flag.String("configFile", "config.json", "File containing config")
+	serve := flag.Bool("serve", false, "Run a local JWKS/OIDC discovery HTTP server instead of printing a token")
+	addr := flag.String("addr", ":8080", "Address to listen on for -serve mode")
+	rotateNow := flag.Bool("rotate-now", false, "Force the key manager to rotate in a new signing key and exit")
+	listKeys := flag.Bool("list-keys", false, "Print the key manager's tracked keys as JSON and exit")
+	keysDir := flag.String("keys-dir", "", "Directory for the key manager's keys (overrides keys_dir in config)")
 	flag.Parse()
 
 	config, err := parseConfig(*configFile)
 	if err != nil {
-		fmt.Print(fmt.Sprintf("\033[31;1m %v \033[0m", err))
+		if *serve || *rotateNow || *listKeys {
+			config = &Config{}
+		} else {
+			fmt.Print(fmt.Sprintf("\033[31;1m %v \033[0m", err))
+		}
+	}
+
+	if *rotateNow || *listKeys {
+		err := handleKeyManagerCommand(*config, *keysDir, *rotateNow, *listKeys)
+		if err != nil {
+			fmt.Print(fmt.Sprintf("\033[31;1m %v \033[0m", err))
+		}
+		return
+	}
+
+	if *serve {
+		err := runServer(ServeParams{
+			Config:  *config,
+			Addr:    *addr,
+			KeysDir: *keysDir,
+		})
+		if err != nil {
+			fmt.Print(fmt.Sprintf("\033[31;1m %v \033[0m", err))
+		}
+		return
 	}
 
 	if !config.UseRS {
@@ -81,6 +125,7 @@ func main() {
 		})
 		if err != nil {
 			fmt.Print(fmt.Sprintf("\033[31;1m %v \033[0m", err))
+			os.Exit(1)
 		}
 		fmt.Print(fmt.Sprintf("ACCESS TOKEN:\n\033[32;1m%s\033[0m", *token))
 		return
@@ -91,6 +136,7 @@ func main() {
 	})
 	if err != nil {
 		fmt.Print(fmt.Sprintf("\033[31;1m %v \033[0m", err))
+		os.Exit(1)
 	}
 	fmt.Print(fmt.Sprintf("\n\nACCESS TOKEN:\n\033[32;1m%s\033[0m", string(token.AccessToken)))
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+type ServeParams struct {
+	Config  Config
+	Addr    string
+	KeysDir string
+}
+
+type openIDConfiguration struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	GrantTypesSupported              []string `json:"grant_types_supported"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// rfc7638Thumbprint derives a stable `kid` from a JWK's RFC 7638 thumbprint.
+func rfc7638Thumbprint(jwkKey jwk.Key) (string, error) {
+	thumbprint, err := jwkKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+// mintServeToken signs claims with the key manager's active key, filling in
+// the same default claims createToken does for the custom-token flow.
+func mintServeToken(claims jwt.MapClaims, km *KeyManager) (string, error) {
+	if err := applyDefaultClaims(claims, time.Hour); err != nil {
+		return "", err
+	}
+
+	privateKey, kid, err := km.ActiveKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	return token.SignedString(privateKey)
+}
+
+func writeServeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		fmt.Print(fmt.Sprintf("\nERROR: writeServeJSON: %v\n", err))
+	}
+}
+
+func handleTokenRequest(w http.ResponseWriter, r *http.Request, km *KeyManager, issuer string) {
+	if err := r.ParseForm(); err != nil {
+		writeServeJSON(w, http.StatusBadRequest, OauthTokenResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+		return
+	}
+
+	grantType := r.Form.Get("grant_type")
+	clientID := r.Form.Get("client_id")
+
+	var subject string
+	switch grantType {
+	case "client_credentials":
+		subject = clientID
+	case "password":
+		subject = r.Form.Get("username")
+	default:
+		writeServeJSON(w, http.StatusBadRequest, OauthTokenResponse{Error: "unsupported_grant_type"})
+		return
+	}
+
+	audience := r.Form.Get("audience")
+	if audience == "" {
+		audience = issuer
+	}
+
+	claims := jwt.MapClaims{
+		"iss":       issuer,
+		"aud":       audience,
+		"sub":       subject,
+		"client_id": clientID,
+	}
+
+	tokenString, err := mintServeToken(claims, km)
+	if err != nil {
+		writeServeJSON(w, http.StatusInternalServerError, OauthTokenResponse{Error: "server_error", ErrorDescription: err.Error()})
+		return
+	}
+
+	writeServeJSON(w, http.StatusOK, OauthTokenResponse{
+		AccessToken: tokenString,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Hour.Seconds()),
+	})
+}
+
+func handleIntrospectRequest(w http.ResponseWriter, r *http.Request, km *KeyManager) {
+	if err := r.ParseForm(); err != nil {
+		writeServeJSON(w, http.StatusBadRequest, map[string]interface{}{"active": false})
+		return
+	}
+
+	tokenString := r.Form.Get("token")
+	if tokenString == "" {
+		writeServeJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+		return
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != "RS256" {
+			return nil, errors.New(fmt.Sprintf("unexpected signing method: %v", token.Header["alg"]))
+		}
+		kid, _ := token.Header["kid"].(string)
+		return km.PublicKeyForKID(kid)
+	})
+	if err != nil || !token.Valid {
+		writeServeJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+		return
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		writeServeJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+		return
+	}
+
+	response := map[string]interface{}{"active": true}
+	for claim, value := range claims {
+		response[claim] = value
+	}
+
+	writeServeJSON(w, http.StatusOK, response)
+}
+
+func runServer(params ServeParams) error {
+	dir := resolveKeysDir(params.Config, params.KeysDir)
+
+	rotationInterval, err := resolveRotationInterval(params.Config)
+	if err != nil {
+		return errors.New(fmt.Sprintf("ERROR: runServer:resolveRotationInterval: %v", err))
+	}
+
+	km, err := NewKeyManager(dir, rotationInterval, defaultRetainedKeys, seedPrivateKeyPEM(params.Config))
+	if err != nil {
+		return errors.New(fmt.Sprintf("ERROR: runServer:NewKeyManager: %v", err))
+	}
+
+	if rotationInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(rotationInterval / 10)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := km.MaybeRotate(); err != nil {
+					fmt.Print(fmt.Sprintf("\nERROR: runServer:MaybeRotate: %v\n", err))
+				}
+			}
+		}()
+	}
+
+	issuer := fmt.Sprintf("http://%s", params.Addr)
+	if params.Config.Serve.Issuer != nil {
+		issuer = *params.Config.Serve.Issuer
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeServeJSON(w, http.StatusOK, openIDConfiguration{
+			Issuer:                           issuer,
+			JWKSURI:                          issuer + "/.well-known/jwks.json",
+			TokenEndpoint:                    issuer + "/oauth/token",
+			IntrospectionEndpoint:            issuer + "/introspect",
+			GrantTypesSupported:              []string{"client_credentials", "password"},
+			ResponseTypesSupported:           []string{"token"},
+			SubjectTypesSupported:            []string{"public"},
+			IDTokenSigningAlgValuesSupported: []string{"RS256"},
+		})
+	})
+
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		jwks, err := km.JWKS()
+		if err != nil {
+			writeServeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeServeJSON(w, http.StatusOK, jwks)
+	})
+
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		handleTokenRequest(w, r, km, issuer)
+	})
+
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		handleIntrospectRequest(w, r, km)
+	})
+
+	_, activeKID, err := km.ActiveKey()
+	if err != nil {
+		return errors.New(fmt.Sprintf("ERROR: runServer:ActiveKey: %v", err))
+	}
+	fmt.Print(fmt.Sprintf("\nServing JWKS/OIDC discovery endpoints on %s (active kid: %s)\n", params.Addr, activeKID))
+
+	return http.ListenAndServe(params.Addr, mux)
+}
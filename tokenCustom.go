@@ -1,12 +1,13 @@
 package main
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
@@ -15,6 +16,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 )
 
@@ -40,9 +42,12 @@ type JWKSets struct {
 type CreateTokenParams struct {
 	Claims             jwt.MapClaims
 	Headers            map[string]*string
+	Alg                string
+	Secret             *string
 	PrivateKeyFilePath string
 	WellKnownEndpoint  string
 	JWKFile            string
+	Encryption         *EncryptionConfig
 	Debug              bool
 }
 
@@ -53,6 +58,38 @@ type GetJWKSetParams struct {
 	Debug             bool
 }
 
+// signingMethodsByAlg maps the `alg` config value to the jwt.SigningMethod
+// used to sign and verify the token. "none" is deliberately omitted so it
+// is always rejected.
+var signingMethodsByAlg = map[string]jwt.SigningMethod{
+	"HS256": jwt.SigningMethodHS256,
+	"HS384": jwt.SigningMethodHS384,
+	"HS512": jwt.SigningMethodHS512,
+	"RS256": jwt.SigningMethodRS256,
+	"RS384": jwt.SigningMethodRS384,
+	"RS512": jwt.SigningMethodRS512,
+	"PS256": jwt.SigningMethodPS256,
+	"PS384": jwt.SigningMethodPS384,
+	"PS512": jwt.SigningMethodPS512,
+	"ES256": jwt.SigningMethodES256,
+	"ES384": jwt.SigningMethodES384,
+	"ES512": jwt.SigningMethodES512,
+	"EdDSA": jwt.SigningMethodEdDSA,
+}
+
+func getSigningMethod(alg string) (jwt.SigningMethod, error) {
+	if alg == "none" {
+		return nil, errors.New(`alg "none" is not supported`)
+	}
+
+	method, ok := signingMethodsByAlg[alg]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unsupported alg: %s", alg))
+	}
+
+	return method, nil
+}
+
 func generateJTI() (string, error) {
 	b := make([]byte, 16)
 	_, err := rand.Read(b)
@@ -62,7 +99,64 @@ func generateJTI() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-func getJwkSet(params *GetJWKSetParams) ([]byte, error) {
+// loadSigningKey returns the key material to pass to token.SignedString for
+// the given alg: a []byte secret for HS*, and a parsed private key for
+// everything else.
+func loadSigningKey(alg string, params CreateTokenParams) (interface{}, error) {
+	switch {
+	case alg == "HS256" || alg == "HS384" || alg == "HS512":
+		if params.Secret != nil {
+			return []byte(*params.Secret), nil
+		}
+		if params.PrivateKeyFilePath == "" {
+			return nil, errors.New("secret or private_key_file_path is required for HMAC algorithms")
+		}
+		secret, err := os.ReadFile(params.PrivateKeyFilePath)
+		if err != nil {
+			return nil, err
+		}
+		return secret, nil
+	case alg == "ES256" || alg == "ES384" || alg == "ES512":
+		keyFile, err := os.ReadFile(params.PrivateKeyFilePath)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.ParseECPrivateKeyFromPEM(keyFile)
+	case alg == "EdDSA":
+		keyFile, err := os.ReadFile(params.PrivateKeyFilePath)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.ParseEdPrivateKeyFromPEM(keyFile)
+	default:
+		// RS256/384/512 and PS256/384/512 all sign with an RSA private key.
+		keyFile, err := os.ReadFile(params.PrivateKeyFilePath)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.ParseRSAPrivateKeyFromPEM(keyFile)
+	}
+}
+
+// rawKeyFor returns a freshly allocated zero value of the Go type that
+// corresponds to the given JWK key type, suitable for passing to
+// jwk.Key.Raw.
+func rawKeyFor(kty jwa.KeyType) (interface{}, error) {
+	switch kty {
+	case jwa.RSA:
+		return &rsa.PublicKey{}, nil
+	case jwa.EC:
+		return &ecdsa.PublicKey{}, nil
+	case jwa.OKP:
+		return &ed25519.PublicKey{}, nil
+	case jwa.OctetSeq:
+		return &[]byte{}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported JWK kty: %s", kty))
+	}
+}
+
+func getJwkSet(params *GetJWKSetParams) (crypto.PublicKey, error) {
 	useLocalJWK := params.JWKFile != ""
 
 	var jwkJSON []byte
@@ -115,34 +209,32 @@ func getJwkSet(params *GetJWKSetParams) ([]byte, error) {
 		}
 	}
 
-	var rawKey rsa.PublicKey
-	if err := jwkKey.Raw(&rawKey); err != nil {
+	rawKey, err := rawKeyFor(jwkKey.KeyType())
+	if err != nil {
 		return nil, err
 	}
 
-	der := x509.MarshalPKCS1PublicKey(&rawKey)
+	if err := jwkKey.Raw(rawKey); err != nil {
+		return nil, err
+	}
 
-	pemBlock := &pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: der,
+	if secret, ok := rawKey.(*[]byte); ok {
+		return *secret, nil
 	}
 
-	pemData := pem.EncodeToMemory(pemBlock)
+	if edKey, ok := rawKey.(*ed25519.PublicKey); ok {
+		return *edKey, nil
+	}
 
-	return pemData, nil
+	return rawKey, nil
 }
 
-func verifyToken(tokenString string, publicKey []byte) (*jwt.Token, error) {
-	parsedPublicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicKey)
-	if err != nil {
-		return nil, err
-	}
-
+func verifyToken(tokenString string, method jwt.SigningMethod, publicKey crypto.PublicKey) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		if token.Method.Alg() != method.Alg() {
 			return nil, errors.New(fmt.Sprintf("unexpected signing method: %v", token.Header["alg"]))
 		}
-		return parsedPublicKey, nil
+		return publicKey, nil
 	})
 
 	if err != nil {
@@ -152,54 +244,75 @@ func verifyToken(tokenString string, publicKey []byte) (*jwt.Token, error) {
 	return token, nil
 }
 
-func createToken(params CreateTokenParams) (string, error) {
-	if params.Claims["exp"] == nil {
-		params.Claims["exp"] = time.Now().Add(time.Hour * 24).Unix()
+// applyDefaultClaims fills in exp/iat/jti when the caller didn't set them,
+// shared by the custom-token flow (createToken) and the serve flow
+// (mintServeToken) so their default-claim behavior can't drift apart.
+func applyDefaultClaims(claims jwt.MapClaims, defaultTTL time.Duration) error {
+	if claims["exp"] == nil {
+		claims["exp"] = time.Now().Add(defaultTTL).Unix()
 	}
 
-	if params.Claims["iat"] == nil {
-		params.Claims["iat"] = time.Now().Unix()
+	if claims["iat"] == nil {
+		claims["iat"] = time.Now().Unix()
 	}
 
-	if params.Claims["jti"] == nil {
+	if claims["jti"] == nil {
 		jti, err := generateJTI()
 		if err != nil {
-			return "", errors.New(fmt.Sprintf("ERROR: createToken:generateJTI: %v", err))
+			return err
 		}
-		params.Claims["jti"] = jti
+		claims["jti"] = jti
+	}
+
+	return nil
+}
+
+func createToken(params CreateTokenParams) (string, error) {
+	if err := applyDefaultClaims(params.Claims, time.Hour*24); err != nil {
+		return "", errors.New(fmt.Sprintf("ERROR: createToken:applyDefaultClaims: %v", err))
+	}
+
+	alg := params.Alg
+	if alg == "" {
+		alg = "RS256"
 	}
 
-	privateKeyFile, err := os.ReadFile(params.PrivateKeyFilePath)
+	method, err := getSigningMethod(alg)
 	if err != nil {
-		return "", errors.New(fmt.Sprintf("ERROR: createToken:ReadFile: %v", err))
+		return "", errors.New(fmt.Sprintf("ERROR: createToken:getSigningMethod: %v", err))
 	}
 
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyFile)
+	signingKey, err := loadSigningKey(alg, params)
 	if err != nil {
-		return "", errors.New(fmt.Sprintf("ERROR: createToken:ParseRSAPrivateKeyFromPEM: %v", err))
+		return "", errors.New(fmt.Sprintf("ERROR: createToken:loadSigningKey: %v", err))
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, params.Claims)
+	token := jwt.NewWithClaims(method, params.Claims)
 	if params.Headers["kid"] != nil {
 		token.Header["kid"] = params.Headers["kid"]
 	}
 
-	tokenString, err := token.SignedString(privateKey)
+	tokenString, err := token.SignedString(signingKey)
 	if err != nil {
 		return "", errors.New(fmt.Sprintf("ERROR: createToken:SignedString: %v", err))
 	}
 
-	publicKey, err := getJwkSet(&GetJWKSetParams{
-		WellKnownEndpoint: params.WellKnownEndpoint,
-		JWKFile:           params.JWKFile,
-		KID:               params.Headers["kid"],
-		Debug:             params.Debug,
-	})
-	if err != nil {
-		return "", errors.New(fmt.Sprintf("ERROR: getJwkSet: %v", err))
+	var verifyKey crypto.PublicKey
+	if secret, ok := signingKey.([]byte); ok {
+		verifyKey = secret
+	} else {
+		verifyKey, err = getJwkSet(&GetJWKSetParams{
+			WellKnownEndpoint: params.WellKnownEndpoint,
+			JWKFile:           params.JWKFile,
+			KID:               params.Headers["kid"],
+			Debug:             params.Debug,
+		})
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("ERROR: getJwkSet: %v", err))
+		}
 	}
 
-	verifiedToken, err := verifyToken(tokenString, publicKey)
+	verifiedToken, err := verifyToken(tokenString, method, verifyKey)
 	if err != nil {
 		return "", errors.New(fmt.Sprintf("ERROR: verifyToken: %v", err))
 	}
@@ -212,15 +325,19 @@ func createToken(params CreateTokenParams) (string, error) {
 		fmt.Print("DEBUG VERIFIED TOKEN:\n\033[34m", string(debugData), "\033[0m\n\n")
 	}
 
+	if params.Encryption != nil {
+		tokenString, err = encryptJWE(tokenString, *params.Encryption)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("ERROR: createToken:encryptJWE: %v", err))
+		}
+	}
+
 	return tokenString, nil
 }
 
 func checkCustomConfig(config Config) error {
-	if config.Custom.PrivateKeyFilePath == nil {
-		return errors.New("iss claim is required in your config json file")
-	}
-	if config.Custom.Claims["iss"] == nil {
-		return errors.New("iss claim is required in your config json file")
+	if config.Custom.PrivateKeyFilePath == nil && config.Custom.Secret == nil {
+		return errors.New("private_key_file_path or secret is required in your config json file")
 	}
 	if config.Custom.Claims["iss"] == nil {
 		return errors.New("iss claim is required in your config json file")
@@ -234,7 +351,7 @@ func checkCustomConfig(config Config) error {
 	if config.Custom.Claims["client_id"] == nil {
 		return errors.New("client_id claim is required in your config json file")
 	}
-	if config.Custom.WellKnownEndpoint == nil {
+	if config.Custom.WellKnownEndpoint == nil && config.Custom.Secret == nil {
 		return errors.New("wk_path claim is required in your config json file")
 	}
 
@@ -247,12 +364,30 @@ func handleCustomToken(params HandleCustomTokenParams) (*string, error) {
 		return nil, err
 	}
 
+	alg := ""
+	if params.Config.Custom.Alg != nil {
+		alg = *params.Config.Custom.Alg
+	}
+
+	privateKeyFilePath := ""
+	if params.Config.Custom.PrivateKeyFilePath != nil {
+		privateKeyFilePath = *params.Config.Custom.PrivateKeyFilePath
+	}
+
+	wellKnownEndpoint := ""
+	if params.Config.Custom.WellKnownEndpoint != nil {
+		wellKnownEndpoint = *params.Config.Custom.WellKnownEndpoint
+	}
+
 	tokenString, err := createToken(CreateTokenParams{
 		Claims:             params.Config.Custom.Claims,
 		Headers:            params.Config.Custom.Header,
-		PrivateKeyFilePath: *params.Config.Custom.PrivateKeyFilePath,
-		WellKnownEndpoint:  *params.Config.Custom.WellKnownEndpoint,
+		Alg:                alg,
+		Secret:             params.Config.Custom.Secret,
+		PrivateKeyFilePath: privateKeyFilePath,
+		WellKnownEndpoint:  wellKnownEndpoint,
 		JWKFile:            params.Config.Custom.JWKLocalFile,
+		Encryption:         params.Config.Custom.Encryption,
 		Debug:              params.Config.Debug,
 	})
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -51,6 +52,31 @@ type MGMTAPIRequestParams struct {
 	Debug              bool
 }
 
+// IdPProvider abstracts the identity-provider-specific calls handleRSToken
+// needs to set up a resource server, grant a client access to it, and mint
+// an end-user access token. Concrete implementations live in idp.go.
+type IdPProvider interface {
+	GetManagementToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error)
+	EnsureResourceServer(params MGMTAPIRequestParams) error
+	EnsureClientGrant(params MGMTAPIRequestParams) error
+	GetUserToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error)
+}
+
+func getIdPProvider(provider string) (IdPProvider, error) {
+	switch provider {
+	case "", "auth0":
+		return Auth0Provider{}, nil
+	case "keycloak":
+		return KeycloakProvider{}, nil
+	case "okta":
+		return OktaProvider{}, nil
+	case "generic":
+		return GenericOIDCProvider{}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported RS provider: %s", provider))
+	}
+}
+
 func executeHttpPostRequest(params ExecuteHttpPostRequestParams) ([]byte, error) {
 	req, err := http.NewRequest("POST", params.URL, params.Payload)
 	if err != nil {
@@ -84,9 +110,12 @@ func executeOauthTokenRequest(params ExecuteHttpPostRequestParams) (*OauthTokenR
 			ContentType: "application/x-www-form-urlencoded",
 		},
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	var tokenResponse OauthTokenResponse
-	err = json.Unmarshal([]byte(body), &tokenResponse)
+	err = json.Unmarshal(body, &tokenResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -105,34 +134,47 @@ func executeOauthTokenRequest(params ExecuteHttpPostRequestParams) (*OauthTokenR
 	return &tokenResponse, nil
 }
 
-func getMGMTAPIToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error) {
-	payload := strings.NewReader(fmt.Sprintf("grant_type=client_credentials&client_id=%s&client_secret=%s&audience=%s", params.ClientID, params.ClientSecret, fmt.Sprintf("https://%s/api/v2/", params.Domain)))
+// Auth0Provider is the original, still-default IdPProvider: it drives
+// Auth0's Management API to provision a "My Account API" resource server
+// with the rfc9068_profile token dialect, matching createMyAccountRS below.
+type Auth0Provider struct{}
+
+func (Auth0Provider) GetManagementToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error) {
+	payload := url.Values{}
+	payload.Set("grant_type", "client_credentials")
+	payload.Set("client_id", params.ClientID)
+	payload.Set("client_secret", params.ClientSecret)
+	payload.Set("audience", fmt.Sprintf("https://%s/api/v2/", params.Domain))
 
-	tokenResponse, err := executeOauthTokenRequest(ExecuteHttpPostRequestParams{
-		Payload: payload,
+	return executeOauthTokenRequest(ExecuteHttpPostRequestParams{
+		Payload: strings.NewReader(payload.Encode()),
 		URL:     fmt.Sprintf("https://%s/oauth/token", params.Domain),
 		Headers: RequestHeaders{
 			ContentType: "application/x-www-form-urlencoded",
 		},
 		Debug: params.Debug,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	return tokenResponse, nil
 }
 
-func createMyAccountRS(params MGMTAPIRequestParams) error {
-	payload := strings.NewReader(fmt.Sprintf("{ \"identifier\": \"%s\", \"name\": \"Auth0 My Account API\", \"skip_consent_for_verifiable_first_party_clients\": false, \"token_dialect\": \"rfc9068_profile\" }", fmt.Sprintf("https://%s/me/", params.Domain)))
+func (Auth0Provider) EnsureResourceServer(params MGMTAPIRequestParams) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"identifier": fmt.Sprintf("https://%s/me/", params.Domain),
+		"name":       "Auth0 My Account API",
+		"skip_consent_for_verifiable_first_party_clients": false,
+		"token_dialect": "rfc9068_profile",
+	})
+	if err != nil {
+		return err
+	}
 
 	body, err := executeHttpPostRequest(ExecuteHttpPostRequestParams{
-		Payload: payload,
+		Payload: strings.NewReader(string(payload)),
 		URL:     fmt.Sprintf("https://%s/api/v2/resource-servers", params.Domain),
 		Headers: RequestHeaders{
 			ContentType:   "application/json",
 			Authorization: fmt.Sprintf("Bearer %s", params.OauthTokenResponse.AccessToken),
 		},
+		Debug: params.Debug,
 	})
 	if err != nil {
 		return err
@@ -147,7 +189,7 @@ func createMyAccountRS(params MGMTAPIRequestParams) error {
 	}
 
 	var api2Response API2PostResponse
-	err = json.Unmarshal([]byte(body), &api2Response)
+	err = json.Unmarshal(body, &api2Response)
 	if err != nil {
 		return err
 	}
@@ -158,16 +200,24 @@ func createMyAccountRS(params MGMTAPIRequestParams) error {
 	return nil
 }
 
-func createMyAccountClientGrant(params MGMTAPIRequestParams) error {
-	payload := strings.NewReader(fmt.Sprintf("{ \"client_id\": \"%s\", \"audience\": \"%s\", \"scope\": [\"create:authentication-methods\"] }", params.ClientID, fmt.Sprintf("https://%s/me/", params.Domain)))
+func (Auth0Provider) EnsureClientGrant(params MGMTAPIRequestParams) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"client_id": params.ClientID,
+		"audience":  fmt.Sprintf("https://%s/me/", params.Domain),
+		"scope":     []string{"create:authentication-methods"},
+	})
+	if err != nil {
+		return err
+	}
 
 	body, err := executeHttpPostRequest(ExecuteHttpPostRequestParams{
-		Payload: payload,
+		Payload: strings.NewReader(string(payload)),
 		URL:     fmt.Sprintf("https://%s/api/v2/client-grants", params.Domain),
 		Headers: RequestHeaders{
 			ContentType:   "application/json",
 			Authorization: fmt.Sprintf("Bearer %s", params.OauthTokenResponse.AccessToken),
 		},
+		Debug: params.Debug,
 	})
 	if err != nil {
 		return err
@@ -182,7 +232,7 @@ func createMyAccountClientGrant(params MGMTAPIRequestParams) error {
 	}
 
 	var api2Response API2PostResponse
-	err = json.Unmarshal([]byte(body), &api2Response)
+	err = json.Unmarshal(body, &api2Response)
 	if err != nil {
 		return err
 	}
@@ -193,22 +243,24 @@ func createMyAccountClientGrant(params MGMTAPIRequestParams) error {
 	return nil
 }
 
-func getRSAccessToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error) {
-	payload := strings.NewReader(fmt.Sprintf("grant_type=password&username=%s&password=%s&scope=create:authentication-methods&audience=%s&client_id=%s&client_secret=%s", params.Username, params.Password, fmt.Sprintf("https://%s/me/", params.Domain), params.ClientID, params.ClientSecret))
-
-	tokenResponse, err := executeOauthTokenRequest(ExecuteHttpPostRequestParams{
-		Payload: payload,
+func (Auth0Provider) GetUserToken(params MGMTAPIRequestParams) (*OauthTokenResponse, error) {
+	payload := url.Values{}
+	payload.Set("grant_type", "password")
+	payload.Set("username", params.Username)
+	payload.Set("password", params.Password)
+	payload.Set("scope", "create:authentication-methods")
+	payload.Set("audience", fmt.Sprintf("https://%s/me/", params.Domain))
+	payload.Set("client_id", params.ClientID)
+	payload.Set("client_secret", params.ClientSecret)
+
+	return executeOauthTokenRequest(ExecuteHttpPostRequestParams{
+		Payload: strings.NewReader(payload.Encode()),
 		URL:     fmt.Sprintf("https://%s/oauth/token", params.Domain),
 		Headers: RequestHeaders{
 			ContentType: "application/x-www-form-urlencoded",
 		},
 		Debug: params.Debug,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	return tokenResponse, nil
 }
 
 func checkConfig(config Config) error {
@@ -237,8 +289,18 @@ func handleRSToken(params HandleRSTokenParams) (*OauthTokenResponse, error) {
 		return nil, err
 	}
 
+	provider := ""
+	if params.Config.RS.Provider != nil {
+		provider = *params.Config.RS.Provider
+	}
+
+	idp, err := getIdPProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+
 	if params.Config.RS.SetupRS {
-		mgmtAPIToken, err := getMGMTAPIToken(MGMTAPIRequestParams{
+		mgmtAPIToken, err := idp.GetManagementToken(MGMTAPIRequestParams{
 			ClientID:     *params.Config.RS.ClientID,
 			ClientSecret: *params.Config.RS.ClientSecret,
 			Domain:       *params.Config.RS.Domain,
@@ -248,7 +310,7 @@ func handleRSToken(params HandleRSTokenParams) (*OauthTokenResponse, error) {
 			return nil, err
 		}
 
-		err = createMyAccountRS(MGMTAPIRequestParams{
+		err = idp.EnsureResourceServer(MGMTAPIRequestParams{
 			OauthTokenResponse: *mgmtAPIToken,
 			Domain:             *params.Config.RS.Domain,
 			Debug:              params.Config.Debug,
@@ -257,7 +319,7 @@ func handleRSToken(params HandleRSTokenParams) (*OauthTokenResponse, error) {
 			return nil, err
 		}
 
-		err = createMyAccountClientGrant(MGMTAPIRequestParams{
+		err = idp.EnsureClientGrant(MGMTAPIRequestParams{
 			OauthTokenResponse: *mgmtAPIToken,
 			Domain:             *params.Config.RS.Domain,
 			ClientID:           *params.Config.RS.ClientID,
@@ -268,7 +330,7 @@ func handleRSToken(params HandleRSTokenParams) (*OauthTokenResponse, error) {
 		}
 	}
 
-	token, err := getRSAccessToken(MGMTAPIRequestParams{
+	token, err := idp.GetUserToken(MGMTAPIRequestParams{
 		Domain:       *params.Config.RS.Domain,
 		ClientID:     *params.Config.RS.ClientID,
 		ClientSecret: *params.Config.RS.ClientSecret,
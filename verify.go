@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// VerificationReport is the structured result printed by the `verify`
+// subcommand, suitable for scripting against in CI.
+type VerificationReport struct {
+	Header         map[string]interface{} `json:"header"`
+	Claims         jwt.MapClaims          `json:"claims"`
+	Encrypted      bool                   `json:"encrypted,omitempty"`
+	SignatureValid bool                   `json:"signature_valid"`
+	Valid          bool                   `json:"valid"`
+	Errors         []string               `json:"errors,omitempty"`
+}
+
+// rfc9068RequiredClaims lists the claims RFC 9068 requires of an access
+// token, beyond the standard-claim checks already performed.
+var rfc9068RequiredClaims = []string{"iss", "exp", "aud", "sub", "client_id", "iat", "jti"}
+
+func resolveVerifyToken(tokenFlag string, url string) (string, error) {
+	if tokenFlag != "" {
+		return tokenFlag, nil
+	}
+
+	if url != "" {
+		res, err := http.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return "", err
+		}
+
+		var tokenResponse OauthTokenResponse
+		if err := json.Unmarshal(body, &tokenResponse); err != nil {
+			return "", errors.New(fmt.Sprintf("response from -url was not a valid oauth token response: %v", err))
+		}
+
+		if tokenResponse.AccessToken == "" {
+			return "", errors.New("response from -url did not include an access_token")
+		}
+
+		return tokenResponse.AccessToken, nil
+	}
+
+	tokenBytes, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(tokenBytes)), nil
+}
+
+// checkStandardClaims reports standard claims required of every token
+// regardless of dialect.
+func checkStandardClaims(claims jwt.MapClaims) []string {
+	var errs []string
+
+	for _, claim := range []string{"iss", "aud", "sub", "client_id"} {
+		if claims[claim] == nil {
+			errs = append(errs, fmt.Sprintf("missing standard claim: %s", claim))
+		}
+	}
+
+	return errs
+}
+
+// checkTimeSkew reports exp/nbf/iat violations relative to now.
+func checkTimeSkew(claims jwt.MapClaims) []string {
+	var errs []string
+	now := time.Now()
+
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(now) {
+		errs = append(errs, fmt.Sprintf("token expired at %s", exp.String()))
+	}
+
+	if nbf, err := claims.GetNotBefore(); err == nil && nbf != nil && nbf.After(now) {
+		errs = append(errs, fmt.Sprintf("token not valid until %s", nbf.String()))
+	}
+
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil && iat.After(now) {
+		errs = append(errs, fmt.Sprintf("token issued in the future: %s", iat.String()))
+	}
+
+	return errs
+}
+
+// checkRFC9068Profile reports RFC 9068 resource-server profile violations:
+// typ=at+jwt and the claims Auth0's rfc9068_profile resource servers
+// (see Auth0Provider.EnsureResourceServer) require.
+func checkRFC9068Profile(header map[string]interface{}, claims jwt.MapClaims) []string {
+	var errs []string
+
+	if typ, _ := header["typ"].(string); typ != "at+jwt" {
+		errs = append(errs, fmt.Sprintf(`rfc9068_profile requires header typ "at+jwt", got %q`, typ))
+	}
+
+	for _, claim := range rfc9068RequiredClaims {
+		if claims[claim] == nil {
+			errs = append(errs, fmt.Sprintf("rfc9068_profile requires claim: %s", claim))
+		}
+	}
+
+	return errs
+}
+
+func buildVerificationReport(tokenString string, config Config) (*VerificationReport, error) {
+	encrypted := isJWE(tokenString)
+	if encrypted {
+		if config.Custom.Encryption == nil {
+			return nil, errors.New("ERROR: buildVerificationReport: token is a JWE but config has no custom.encryption settings to decrypt it with")
+		}
+
+		decrypted, err := decryptJWE(tokenString, *config.Custom.Encryption)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("ERROR: buildVerificationReport:decryptJWE: %v", err))
+		}
+		tokenString = decrypted
+	}
+
+	parser := jwt.NewParser()
+	unverified, _, err := parser.ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("ERROR: buildVerificationReport:ParseUnverified: %v", err))
+	}
+
+	claims, ok := unverified.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("ERROR: buildVerificationReport: could not read claims from token")
+	}
+
+	report := &VerificationReport{
+		Header:    unverified.Header,
+		Claims:    claims,
+		Encrypted: encrypted,
+	}
+
+	alg, _ := unverified.Header["alg"].(string)
+	method, err := getSigningMethod(alg)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		var kid *string
+		if kidString, ok := unverified.Header["kid"].(string); ok && kidString != "" {
+			kid = &kidString
+		}
+
+		wellKnownEndpoint := ""
+		if config.Custom.WellKnownEndpoint != nil {
+			wellKnownEndpoint = *config.Custom.WellKnownEndpoint
+		}
+
+		publicKey, err := getJwkSet(&GetJWKSetParams{
+			WellKnownEndpoint: wellKnownEndpoint,
+			JWKFile:           config.Custom.JWKLocalFile,
+			KID:               kid,
+			Debug:             config.Debug,
+		})
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("ERROR: getJwkSet: %v", err))
+		} else {
+			verifiedToken, err := verifyToken(tokenString, method, publicKey)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("signature verification failed: %v", err))
+			} else {
+				report.SignatureValid = verifiedToken.Valid
+			}
+		}
+	}
+
+	report.Errors = append(report.Errors, checkTimeSkew(claims)...)
+	report.Errors = append(report.Errors, checkStandardClaims(claims)...)
+
+	if config.Custom.TokenDialect != nil && *config.Custom.TokenDialect == "rfc9068_profile" {
+		report.Errors = append(report.Errors, checkRFC9068Profile(unverified.Header, claims)...)
+	}
+
+	report.Valid = report.SignatureValid && len(report.Errors) == 0
+
+	return report, nil
+}
+
+func runVerifyCommand(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	configFile := fs.String("configFile", "config.json", "File containing config")
+	tokenFlag := fs.String("token", "", "The JWT to verify")
+	url := fs.String("url", "", "Fetch the token from this URL's JSON oauth token response (access_token field)")
+	fs.Parse(args)
+
+	config, err := parseConfig(*configFile)
+	if err != nil {
+		fmt.Print(fmt.Sprintf("\033[31;1m %v \033[0m", err))
+		return 1
+	}
+
+	tokenString, err := resolveVerifyToken(*tokenFlag, *url)
+	if err != nil {
+		fmt.Print(fmt.Sprintf("\033[31;1m %v \033[0m", err))
+		return 1
+	}
+
+	report, err := buildVerificationReport(tokenString, *config)
+	if err != nil {
+		fmt.Print(fmt.Sprintf("\033[31;1m %v \033[0m", err))
+		return 1
+	}
+
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Print(fmt.Sprintf("\033[31;1m %v \033[0m", err))
+		return 1
+	}
+
+	if report.Valid {
+		fmt.Print(fmt.Sprintf("\033[32;1m%s\033[0m\n", string(reportJSON)))
+		return 0
+	}
+
+	fmt.Print(fmt.Sprintf("\033[31;1m%s\033[0m\n", string(reportJSON)))
+	return 1
+}